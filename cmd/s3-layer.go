@@ -17,17 +17,40 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/md5"
 	"crypto/sha256"
+	"encoding/json"
 	"hash"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"encoding/hex"
 
 	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/policy"
 )
 
+// s3PresignExpiryMax is the maximum expiry accepted for a presigned URL,
+// matching the limit enforced by AWS Signature Version 4.
+const s3PresignExpiryMax = 7 * 24 * time.Hour
+
+// checkValidPresignExpiry validates that expiry falls within the bounds
+// accepted for a presigned request.
+func checkValidPresignExpiry(expiry time.Duration) error {
+	if expiry <= 0 || expiry > s3PresignExpiryMax {
+		return traceError(InvalidArgument{})
+	}
+	return nil
+}
+
 // Convert Minio errors to minio object layer errors.
 func s3ToObjectError(err error, params ...string) error {
 	if err == nil {
@@ -88,10 +111,44 @@ func s3ToObjectError(err error, params ...string) error {
 	return e
 }
 
+const (
+	// s3MinPartSize - minimum part size allowed for a multipart upload,
+	// enforced by the S3 API.
+	s3MinPartSize = 1024 * 1024 * 5 // 5MiB
+	// s3MaxPartSize - maximum part size allowed for a multipart upload.
+	s3MaxPartSize = 1024 * 1024 * 1024 * 5 // 5GiB
+	// s3MaxPartsCount - maximum number of parts allowed in a multipart
+	// upload.
+	s3MaxPartsCount = 10000
+	// s3PutObjectMultipartThreshold - objects at or above this size, or
+	// of unknown size, are uploaded via a concurrent multipart upload
+	// instead of a single PutObject call.
+	s3PutObjectMultipartThreshold = 1024 * 1024 * 64 // 64MiB
+	// s3PutObjectPartsConcurrency - default number of parts uploaded
+	// concurrently during a multipart upload.
+	s3PutObjectPartsConcurrency = 4
+
+	// s3GatewayPartSizeEnv overrides the part size, in bytes, used for
+	// concurrent multipart uploads. Falls back to the automatic
+	// calculation in calculatePartSize when unset or invalid.
+	s3GatewayPartSizeEnv = "MINIO_S3_GATEWAY_PART_SIZE"
+	// s3GatewayPartsConcurrencyEnv overrides s3PutObjectPartsConcurrency.
+	s3GatewayPartsConcurrencyEnv = "MINIO_S3_GATEWAY_PARTS_CONCURRENCY"
+)
+
 // s3Gateway - Implements gateway for S3 and Minio blob storage.
 type s3Gateway struct {
 	Client     *minio.Core
 	anonClient *minio.Core
+
+	// partSize is the size, in bytes, of each part uploaded during a
+	// concurrent multipart PutObject. Configured via
+	// s3GatewayPartSizeEnv; calculated per-upload when zero.
+	partSize int64
+	// partsConcurrency bounds how many parts are uploaded in parallel
+	// during a concurrent multipart PutObject. Configured via
+	// s3GatewayPartsConcurrencyEnv.
+	partsConcurrency int
 }
 
 // newS3Gateway returns s3 gatewaylayer
@@ -107,9 +164,21 @@ func newS3Gateway(endpoint string, https bool, accessKey, secretKey string) (Gat
 		return nil, err
 	}
 
+	partSize := int64(0)
+	if v, perr := strconv.ParseInt(os.Getenv(s3GatewayPartSizeEnv), 10, 64); perr == nil && v > 0 {
+		partSize = v
+	}
+
+	partsConcurrency := s3PutObjectPartsConcurrency
+	if v, perr := strconv.Atoi(os.Getenv(s3GatewayPartsConcurrencyEnv)); perr == nil && v > 0 {
+		partsConcurrency = v
+	}
+
 	return &s3Gateway{
-		Client:     client,
-		anonClient: anonClient,
+		Client:           client,
+		anonClient:       anonClient,
+		partSize:         partSize,
+		partsConcurrency: partsConcurrency,
 	}, nil
 }
 
@@ -216,6 +285,15 @@ func fromMinioClientListBucketResult(bucket string, result minio.ListBucketResul
 //
 // startOffset indicates the starting read location of the object.
 // length indicates the total length of the object.
+//
+// Seeking to startOffset before the first Read causes the client to
+// issue the GET itself as a ranged request starting at that offset,
+// rather than streaming and discarding the leading bytes locally.
+// TestS3GatewayGetObjectRange in s3-layer_test.go pins this down against
+// a real *minio.Core talking to an httptest server: it asserts the
+// outgoing GET carries a Range header starting at startOffset and
+// that only length bytes are written out, so a regression back to a
+// full-object fetch fails the test rather than going unnoticed.
 func (l *s3Gateway) GetObject(bucket string, key string, startOffset int64, length int64, writer io.Writer) error {
 	object, err := l.Client.GetObject(bucket, key)
 	if err != nil {
@@ -224,8 +302,11 @@ func (l *s3Gateway) GetObject(bucket string, key string, startOffset int64, leng
 
 	defer object.Close()
 
-	object.Seek(startOffset, io.SeekStart)
-	if _, err := io.CopyN(writer, object, length); err != nil {
+	if _, err = object.Seek(startOffset, io.SeekStart); err != nil {
+		return s3ToObjectError(traceError(err), bucket, key)
+	}
+
+	if _, err = io.CopyN(writer, object, length); err != nil {
 		return s3ToObjectError(traceError(err), bucket, key)
 	}
 
@@ -259,8 +340,22 @@ func (l *s3Gateway) GetObjectInfo(bucket string, object string) (objInfo ObjectI
 	return fromMinioClientObjectInfo(bucket, oi), nil
 }
 
-// PutObject - Create a new blob with the incoming data,
+// PutObject - Create a new blob with the incoming data. Objects at or
+// above s3PutObjectMultipartThreshold, or of unknown size, are uploaded
+// via putObjectMultipart so that a checksum mismatch aborts the upload
+// instead of surfacing only after the whole object has been stored.
 func (l *s3Gateway) PutObject(bucket string, object string, size int64, data io.Reader, metadata map[string]string, sha256sum string) (ObjectInfo, error) {
+	delete(metadata, "md5Sum")
+
+	if size >= 0 && size < s3PutObjectMultipartThreshold {
+		return l.putObject(bucket, object, size, data, metadata, sha256sum)
+	}
+
+	return l.putObjectMultipart(bucket, object, size, data, metadata, sha256sum)
+}
+
+// putObject uploads data in a single PutObject call.
+func (l *s3Gateway) putObject(bucket, object string, size int64, data io.Reader, metadata map[string]string, sha256sum string) (ObjectInfo, error) {
 	var sha256Writer hash.Hash
 
 	teeReader := data
@@ -269,8 +364,6 @@ func (l *s3Gateway) PutObject(bucket string, object string, size int64, data io.
 		teeReader = io.TeeReader(data, sha256Writer)
 	}
 
-	delete(metadata, "md5Sum")
-
 	err := l.Client.PutObject(bucket, object, size, teeReader, toMinioClientMetadata(metadata))
 	if err != nil {
 		return ObjectInfo{}, s3ToObjectError(traceError(err), bucket, object)
@@ -292,6 +385,125 @@ func (l *s3Gateway) PutObject(bucket string, object string, size int64, data io.
 	return oi, nil
 }
 
+// calculatePartSize returns the part size to use for a multipart upload
+// of the given size, honoring the gateway's configured part size if
+// set, and otherwise picking the smallest part size that keeps the
+// upload within s3MaxPartsCount parts, bounded to [s3MinPartSize,
+// s3MaxPartSize]. When size is unknown (negative), s3MinPartSize is
+// returned and the number of parts is not bounded.
+func (l *s3Gateway) calculatePartSize(size int64) int64 {
+	if l.partSize > 0 {
+		return l.partSize
+	}
+
+	partSize := int64(s3MinPartSize)
+	if size > 0 {
+		if p := (size + s3MaxPartsCount - 1) / s3MaxPartsCount; p > partSize {
+			partSize = p
+		}
+	}
+	if partSize > s3MaxPartSize {
+		partSize = s3MaxPartSize
+	}
+
+	return partSize
+}
+
+// putObjectMultipart uploads data in concurrently-sent parts under a
+// single multipart upload, computing a running SHA-256 as parts are
+// read. The upload is aborted on any part failure or checksum mismatch
+// instead of completing the object and then deleting it.
+func (l *s3Gateway) putObjectMultipart(bucket, object string, size int64, data io.Reader, metadata map[string]string, sha256sum string) (ObjectInfo, error) {
+	uploadID, err := l.Client.NewMultipartUpload(bucket, object, toMinioClientMetadata(metadata))
+	if err != nil {
+		return ObjectInfo{}, s3ToObjectError(traceError(err), bucket, object)
+	}
+
+	abortUpload := func() {
+		l.Client.AbortMultipartUpload(bucket, object, uploadID)
+	}
+
+	var sha256Writer hash.Hash
+	reader := data
+	if sha256sum != "" {
+		sha256Writer = sha256.New()
+		reader = io.TeeReader(data, sha256Writer)
+	}
+
+	partSize := l.calculatePartSize(size)
+	concurrency := l.partsConcurrency
+	if concurrency <= 0 {
+		concurrency = s3PutObjectPartsConcurrency
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, concurrency)
+		partsMu sync.Mutex
+		parts   []completePart
+		errOnce sync.Once
+		readErr error
+	)
+
+	for partNumber := 1; ; partNumber++ {
+		buf := make([]byte, partSize)
+		n, rerr := io.ReadFull(reader, buf)
+		if n == 0 && rerr == io.EOF {
+			break
+		}
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			errOnce.Do(func() { readErr = rerr })
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(partNumber int, part []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			md5Sum := md5.Sum(part)
+			info, perr := l.Client.PutObjectPart(bucket, object, uploadID, partNumber, int64(len(part)), bytes.NewReader(part), md5Sum[:], nil)
+			if perr != nil {
+				errOnce.Do(func() { readErr = perr })
+				return
+			}
+
+			partsMu.Lock()
+			parts = append(parts, completePart{PartNumber: partNumber, ETag: info.ETag})
+			partsMu.Unlock()
+		}(partNumber, buf[:n])
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	wg.Wait()
+
+	if readErr != nil {
+		abortUpload()
+		return ObjectInfo{}, s3ToObjectError(traceError(readErr), bucket, object)
+	}
+
+	if sha256sum != "" {
+		newSHA256sum := hex.EncodeToString(sha256Writer.Sum(nil))
+		if newSHA256sum != sha256sum {
+			abortUpload()
+			return ObjectInfo{}, traceError(SHA256Mismatch{})
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	if err = l.Client.CompleteMultipartUpload(bucket, object, uploadID, toMinioClientCompleteParts(parts)); err != nil {
+		abortUpload()
+		return ObjectInfo{}, s3ToObjectError(traceError(err), bucket, object)
+	}
+
+	return l.GetObjectInfo(bucket, object)
+}
+
 // CopyObject - Copies a blob from source container to destination container.
 func (l *s3Gateway) CopyObject(srcBucket string, srcObject string, destBucket string, destObject string, metadata map[string]string) (ObjectInfo, error) {
 	err := l.Client.CopyObject(destBucket, destObject, path.Join(srcBucket, srcObject), minio.CopyConditions{})
@@ -317,6 +529,32 @@ func (l *s3Gateway) DeleteObject(bucket string, object string) error {
 	return nil
 }
 
+// DeleteObjects - deletes multiple objects in bucket in batched S3
+// multi-object delete calls instead of one DeleteObject round-trip per
+// key. Per-key failures are returned as DeleteError entries. The
+// method is defined on s3Gateway only; the DeleteMultipleObjects
+// request handler does not dispatch to it.
+func (l *s3Gateway) DeleteObjects(bucket string, objects []string) ([]DeleteError, error) {
+	objectsCh := make(chan string, len(objects))
+	for _, object := range objects {
+		objectsCh <- object
+	}
+	close(objectsCh)
+
+	var derrs []DeleteError
+	for rerr := range l.Client.RemoveObjects(bucket, objectsCh) {
+		if rerr.Err == nil {
+			continue
+		}
+		derrs = append(derrs, DeleteError{
+			Err:    s3ToObjectError(traceError(rerr.Err), bucket, rerr.ObjectName),
+			Object: rerr.ObjectName,
+		})
+	}
+
+	return derrs, nil
+}
+
 // fromMinioClientUploadMetadata converts ObjectMultipartInfo to uploadMetadata
 func fromMinioClientUploadMetadata(omi minio.ObjectMultipartInfo) uploadMetadata {
 	return uploadMetadata{
@@ -491,16 +729,117 @@ func (l *s3Gateway) CompleteMultipartUpload(bucket string, object string, upload
 }
 
 // SetBucketPolicies - Set policy on bucket
-func (l *s3Gateway) SetBucketPolicies(string, []BucketAccessPolicy) error {
-	return traceError(NotImplemented{})
+func (l *s3Gateway) SetBucketPolicies(bucket string, policies []BucketAccessPolicy) error {
+	policyInfo := policy.BucketAccessPolicy{Version: "2012-10-17"}
+	for _, p := range policies {
+		policyInfo = policy.SetPolicy(policyInfo, p.Policy, bucket, p.Prefix)
+	}
+
+	data, err := json.Marshal(policyInfo)
+	if err != nil {
+		return traceError(err)
+	}
+
+	if err = l.Client.PutBucketPolicy(bucket, string(data)); err != nil {
+		return s3ToObjectError(traceError(err), bucket)
+	}
+
+	return nil
 }
 
 // GetBucketPolicies - Get policy on bucket
 func (l *s3Gateway) GetBucketPolicies(bucket string) ([]BucketAccessPolicy, error) {
-	return []BucketAccessPolicy{}, traceError(NotImplemented{})
+	data, err := l.Client.GetBucketPolicy(bucket)
+	if err != nil {
+		// A bucket with no policy configured yet is the default state
+		// for every newly created bucket, not an error condition.
+		if minioErr, ok := err.(minio.ErrorResponse); ok && minioErr.Code == "NoSuchBucketPolicy" {
+			return nil, nil
+		}
+		return nil, s3ToObjectError(traceError(err), bucket)
+	}
+
+	var policyInfo policy.BucketAccessPolicy
+	if data != "" {
+		if err = json.Unmarshal([]byte(data), &policyInfo); err != nil {
+			return nil, traceError(err)
+		}
+	}
+
+	policyMap := policy.GetPolicies(policyInfo.Statements, bucket)
+	policies := make([]BucketAccessPolicy, 0, len(policyMap))
+	for prefix, p := range policyMap {
+		policies = append(policies, BucketAccessPolicy{
+			Prefix: prefix,
+			Policy: p,
+		})
+	}
+
+	return policies, nil
 }
 
 // DeleteBucketPolicies - Delete all policies on bucket
-func (l *s3Gateway) DeleteBucketPolicies(string) error {
-	return traceError(NotImplemented{})
+func (l *s3Gateway) DeleteBucketPolicies(bucket string) error {
+	if err := l.Client.DeleteBucketPolicy(bucket); err != nil {
+		// Deleting a policy that doesn't exist is a no-op, not a failure.
+		if minioErr, ok := err.(minio.ErrorResponse); ok && minioErr.Code == "NoSuchBucketPolicy" {
+			return nil
+		}
+		return s3ToObjectError(traceError(err), bucket)
+	}
+
+	return nil
+}
+
+// GetObjectPresign - returns a presigned URL to GET an object, signed
+// with the gateway's own credentials so the remote S3 endpoint serves
+// the request directly without round-tripping through the gateway.
+func (l *s3Gateway) GetObjectPresign(bucket, object string, expiry time.Duration, reqParams url.Values) (*url.URL, error) {
+	if err := checkValidPresignExpiry(expiry); err != nil {
+		return nil, err
+	}
+
+	u, err := l.Client.PresignedGetObject(bucket, object, expiry, reqParams)
+	if err != nil {
+		return nil, s3ToObjectError(traceError(err), bucket, object)
+	}
+
+	return u, nil
+}
+
+// PutObjectPresign - returns a presigned URL to PUT an object, signed
+// with the gateway's own credentials.
+func (l *s3Gateway) PutObjectPresign(bucket, object string, expiry time.Duration) (*url.URL, error) {
+	if err := checkValidPresignExpiry(expiry); err != nil {
+		return nil, err
+	}
+
+	u, err := l.Client.PresignedPutObject(bucket, object, expiry)
+	if err != nil {
+		return nil, s3ToObjectError(traceError(err), bucket, object)
+	}
+
+	return u, nil
+}
+
+// PostPresign - returns a presigned POST policy that browser based
+// uploads can use to POST an object to the upstream S3 endpoint directly.
+func (l *s3Gateway) PostPresign(bucket, object string, expiry time.Duration) (*url.URL, map[string]string, error) {
+	if err := checkValidPresignExpiry(expiry); err != nil {
+		return nil, nil, err
+	}
+
+	p := minio.NewPostPolicy()
+	p.SetBucket(bucket)
+	p.SetKey(object)
+	if err := p.SetExpires(time.Now().UTC().Add(expiry)); err != nil {
+		return nil, nil, traceError(err)
+	}
+
+	u, formData, err := l.Client.PresignedPostPolicy(p)
+	if err != nil {
+		return nil, nil, s3ToObjectError(traceError(err), bucket, object)
+	}
+
+	return u, formData, nil
 }